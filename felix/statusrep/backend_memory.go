@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+)
+
+// memoryBackend is a StatusBackend that keeps status payloads in memory,
+// keyed by kind and then by key. It exists so tests can exercise
+// EndpointStatusFileReporter without touching the filesystem.
+type memoryBackend struct {
+	mu    sync.Mutex
+	kinds map[string]map[string][]byte
+}
+
+// newMemoryBackend creates an empty memoryBackend.
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{kinds: map[string]map[string][]byte{}}
+}
+
+func (b *memoryBackend) Save(ctx context.Context, kind, key string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m := b.kinds[kind]
+	if m == nil {
+		m = map[string][]byte{}
+		b.kinds[kind] = m
+	}
+	m[key] = payload
+	return nil
+}
+
+func (b *memoryBackend) Remove(ctx context.Context, kind, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.kinds[kind], key)
+	return nil
+}
+
+func (b *memoryBackend) Load(ctx context.Context, kind, key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	payload, ok := b.kinds[kind][key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return payload, nil
+}
+
+func (b *memoryBackend) List(ctx context.Context, kind string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m := b.kinds[kind]
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (b *memoryBackend) Close() error {
+	return nil
+}
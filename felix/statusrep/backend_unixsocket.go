@@ -0,0 +1,153 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// UnixSocketBackend is a StatusBackend that speaks a small line-oriented
+// protocol over a unix domain socket, so a sidecar can receive status
+// updates without sharing a volume with felix. Construct one with
+// NewUnixSocketBackend and pass it to NewEndpointStatusFileReporter via
+// WithStatusBackend. This is an early stub: the wire protocol below is
+// enough to unblock sidecars that only need Save/Remove, but it hasn't been
+// hardened against a slow or misbehaving peer (no timeouts, no
+// reconnect-on-failure) and should not be used in production yet. Every
+// "ERR" reply, including one for a missing key, comes back as a plain
+// error: Load does not return fs.ErrNotExist for a key the peer lacks.
+//
+// Wire protocol, one request per line, newline-terminated:
+//
+//	SAVE <kind> <key> <base64-payload>\n  -> "OK\n" | "ERR <reason>\n"
+//	REMOVE <kind> <key>\n                 -> "OK\n" | "ERR <reason>\n"
+//	LIST <kind>\n                         -> "OK <n>\n" followed by n
+//	                                          "<key>\n" lines, or
+//	                                          "ERR <reason>\n"
+//	LOAD <kind> <key>\n                   -> "OK <base64-payload>\n" |
+//	                                          "ERR <reason>\n"
+type UnixSocketBackend struct {
+	mu   sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// NewUnixSocketBackend dials the unix socket at path and returns a backend
+// that will use it for all Save/Remove/List calls.
+func NewUnixSocketBackend(path string) (*UnixSocketBackend, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("dialing status socket %s: %w", path, err)
+	}
+	return &UnixSocketBackend{
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}, nil
+}
+
+func (b *UnixSocketBackend) Save(ctx context.Context, kind, key string, payload []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(payload)
+	return b.roundTrip(fmt.Sprintf("SAVE %s %s %s\n", kind, key, encoded), nil, nil)
+}
+
+func (b *UnixSocketBackend) Remove(ctx context.Context, kind, key string) error {
+	return b.roundTrip(fmt.Sprintf("REMOVE %s %s\n", kind, key), nil, nil)
+}
+
+func (b *UnixSocketBackend) List(ctx context.Context, kind string) ([]string, error) {
+	var keys []string
+	err := b.roundTrip(fmt.Sprintf("LIST %s\n", kind), &keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (b *UnixSocketBackend) Load(ctx context.Context, kind, key string) ([]byte, error) {
+	var payload []byte
+	err := b.roundTrip(fmt.Sprintf("LOAD %s %s\n", kind, key), nil, &payload)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (b *UnixSocketBackend) Close() error {
+	return b.conn.Close()
+}
+
+// roundTrip sends req and parses the response. For LIST, listOut is
+// populated with the returned filenames; for LOAD, payloadOut is populated
+// with the decoded payload. Both are ignored otherwise.
+func (b *UnixSocketBackend) roundTrip(req string, listOut *[]string, payloadOut *[]byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.rw.WriteString(req); err != nil {
+		return fmt.Errorf("writing to status socket: %w", err)
+	}
+	if err := b.rw.Flush(); err != nil {
+		return fmt.Errorf("flushing status socket: %w", err)
+	}
+
+	status, err := b.rw.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("reading status socket response: %w", err)
+	}
+	status = strings.TrimSuffix(status, "\n")
+
+	switch {
+	case status == "OK":
+		return nil
+	case strings.HasPrefix(status, "ERR "):
+		return fmt.Errorf("status socket peer returned error: %s", strings.TrimPrefix(status, "ERR "))
+	case strings.HasPrefix(status, "OK "):
+		switch {
+		case listOut != nil:
+			var n int
+			if _, err := fmt.Sscanf(status, "OK %d", &n); err != nil {
+				return fmt.Errorf("parsing status socket listing count: %w", err)
+			}
+			lines := make([]string, 0, n)
+			for i := 0; i < n; i++ {
+				line, err := b.rw.ReadString('\n')
+				if err != nil {
+					return fmt.Errorf("reading status socket listing: %w", err)
+				}
+				lines = append(lines, strings.TrimSuffix(line, "\n"))
+			}
+			*listOut = lines
+			return nil
+		case payloadOut != nil:
+			encoded := strings.TrimPrefix(status, "OK ")
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return fmt.Errorf("decoding status socket payload: %w", err)
+			}
+			*payloadOut = decoded
+			return nil
+		default:
+			return fmt.Errorf("unexpected response to request with no output: %q", status)
+		}
+	default:
+		return fmt.Errorf("unrecognised status socket response: %q", status)
+	}
+}
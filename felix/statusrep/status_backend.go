@@ -0,0 +1,131 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// StatusBackend abstracts "where do status-file bytes end up" away from the
+// reconciliation logic in EndpointStatusFileReporter. The reporter only
+// knows how to compute deltas against a desired set of keys per subsystem
+// (kind); a StatusBackend turns those deltas into Save/Remove calls against
+// whatever medium is backing status for a given kind (e.g. "policy",
+// "routes", "ipsets", "bpf").
+//
+// key identifies an entry within kind. For the built-in "policy" subsystem
+// this is a WorkloadEndpointID rendered via
+// names.WorkloadEndpointIDToStatusFilename; other subsystems are free to
+// key on whatever's natural for them (a CIDR, an ipset name, ...), since
+// the backend itself doesn't interpret it.
+type StatusBackend interface {
+	// Save persists payload as the current status for key within kind,
+	// creating or overwriting as required.
+	Save(ctx context.Context, kind, key string, payload []byte) error
+
+	// Remove deletes the status previously saved for key within kind.
+	// Removing a key that was never saved either succeeds or returns an
+	// error wrapping fs.ErrNotExist (localFSBackend does the latter);
+	// reconcileSubsystem treats that error as success.
+	Remove(ctx context.Context, kind, key string) error
+
+	// List returns the keys that currently have a saved status within
+	// kind. Used to rebuild the dataplane side of a subsystem's delta
+	// tracker on a full resync.
+	List(ctx context.Context, kind string) ([]string, error)
+
+	// Load returns the payload last saved for key within kind, so a full
+	// resync can learn what's actually on disk for an already-known key,
+	// not just that it's present. Returns fs.ErrNotExist if key has no
+	// saved payload.
+	Load(ctx context.Context, kind, key string) ([]byte, error)
+
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// localFSBackend is the default StatusBackend. It persists one file per key
+// under <rootDir>/<kind>/, which is the pre-existing on-disk layout; it's
+// factored out here so alternative backends (e.g. a unix socket shared with
+// a sidecar) can be swapped in without touching the reconcile loop.
+type localFSBackend struct {
+	rootDir string
+}
+
+func newLocalFSBackend(rootDir string) *localFSBackend {
+	return &localFSBackend{rootDir: rootDir}
+}
+
+func (b *localFSBackend) Save(ctx context.Context, kind, key string, payload []byte) error {
+	filename := filepath.Join(b.rootDir, kind, key)
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if len(payload) == 0 {
+		return nil
+	}
+	_, err = f.Write(payload)
+	return err
+}
+
+func (b *localFSBackend) Remove(ctx context.Context, kind, key string) error {
+	filename := filepath.Join(b.rootDir, kind, key)
+	return os.Remove(filename)
+}
+
+func (b *localFSBackend) Load(ctx context.Context, kind, key string) ([]byte, error) {
+	filename := filepath.Join(b.rootDir, kind, key)
+	return os.ReadFile(filename)
+}
+
+// List ensures <rootDir>/<kind> exists (creating it on first use) and
+// returns the keys of any entries already present within it.
+func (b *localFSBackend) List(ctx context.Context, kind string) ([]string, error) {
+	dir := filepath.Join(b.rootDir, kind)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, b.ensureKindDir(kind)
+		}
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		keys = append(keys, entry.Name())
+	}
+	return keys, nil
+}
+
+// ensureKindDir creates <rootDir>/<kind> if it doesn't already exist. It's
+// exposed beyond List so SyncForever can create the directory up front,
+// before it starts watching it for out-of-band changes: the watch has to
+// be in place before the directory can receive writes, but List (and so
+// the directory's creation) previously only ran once the reporter started
+// reconciling, which left a boot-time window where fsw.Add(dir) failed
+// because the directory didn't exist yet.
+func (b *localFSBackend) ensureKindDir(kind string) error {
+	return os.MkdirAll(filepath.Join(b.rootDir, kind), 0o755)
+}
+
+func (b *localFSBackend) Close() error {
+	return nil
+}
@@ -16,10 +16,10 @@ package statusrep
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
-	"os"
 	"path/filepath"
 	"time"
 
@@ -36,22 +36,46 @@ const (
 	dirPolicyStatus = "policy"
 )
 
-// EndpointStatusFileReporter writes a file to the FS
+// EndpointStatusFileReporter writes a status entry via its StatusBackend
 // any time it sees an Endpoint go up in the dataplane.
 //
-//   - Currently only writes to a directory "policy", creating
-//     an entry for each workload, when each workload's
-//     policy is programmed for the first time.
+//   - Out of the box, only registers a "policy" subsystem, creating an
+//     entry for each workload when each workload's policy is programmed
+//     for the first time. Callers can register further subsystems (e.g.
+//     "routes", "ipsets", "bpf") with RegisterSubsystem.
 type EndpointStatusFileReporter struct {
 	inSyncC                 <-chan bool
 	endpointUpdatesC        <-chan interface{}
 	endpointStatusDirPrefix string
 
-	// DeltaTracker for the policy subdirectory
-	policyDirDeltaTracker *deltatracker.SetDeltaTracker[*proto.WorkloadEndpointID]
+	// backend is where every subsystem's Save/Remove/List calls end up.
+	// Defaults to a localFSBackend rooted at endpointStatusDirPrefix.
+	backend StatusBackend
+
+	// subsystems is every registered Subsystem, in registration order
+	// (the built-in "policy" subsystem is always first). SyncForever
+	// fans each incoming update out to every subsystem whose matcher
+	// accepts it.
+	subsystems       []*Subsystem
+	subsystemsByName map[string]*Subsystem
 
 	// Wraps and manages a real or mock wait.Backoff.
 	bom backoffManager
+
+	// resyncDebounce and resyncPollInterval configure the out-of-band
+	// change watcher started by SyncForever. See WithResyncDebounce and
+	// WithResyncPollInterval.
+	resyncDebounce     time.Duration
+	resyncPollInterval time.Duration
+
+	// payloadFormat selects what gets written as the body of a
+	// policy-status file. See WithPayloadFormat.
+	payloadFormat PayloadFormat
+
+	// policyPayloads holds the latest known PolicyStatus per endpoint,
+	// keyed by status filename, used to build the FormatJSON payload.
+	// Only touched from SyncForever's goroutine, so it needs no locking.
+	policyPayloads map[string]*PolicyStatus
 }
 
 // Backoff wraps a timer-based-retry type which can be stepped.
@@ -99,8 +123,18 @@ func NewEndpointStatusFileReporter(
 		inSyncC:                 inSyncC,
 		endpointUpdatesC:        endpointUpdatesC,
 		endpointStatusDirPrefix: statusDirPath,
-		policyDirDeltaTracker:   deltatracker.NewSetDeltaTracker[*proto.WorkloadEndpointID](),
+		backend:                 newLocalFSBackend(statusDirPath),
+		subsystemsByName:        map[string]*Subsystem{},
 		bom:                     newBackoffManager(newDefaultBackoff),
+		resyncDebounce:          defaultResyncDebounce,
+		resyncPollInterval:      defaultResyncPollInterval,
+		payloadFormat:           FormatEmpty,
+		policyPayloads:          map[string]*PolicyStatus{},
+	}
+
+	if err := sr.registerSubsystem(dirPolicyStatus, matchWorkloadEndpointStatus, sr.policyPayloadFunc, sr.policyRemoveFunc); err != nil {
+		// Can't happen: nothing else has registered "policy" yet.
+		logrus.WithError(err).Panic("Failed to register built-in policy subsystem")
 	}
 
 	for _, o := range opts {
@@ -118,17 +152,120 @@ func WithNewBackoffFunc(newBackoffFunc func() Backoff) FileReporterOption {
 	}
 }
 
+// WithStatusBackend returns a FileReporterOption which overrides the
+// StatusBackend used to persist status entries. Defaults to a
+// localFSBackend rooted at the statusDirPath passed to
+// NewEndpointStatusFileReporter.
+func WithStatusBackend(backend StatusBackend) FileReporterOption {
+	return func(fr *EndpointStatusFileReporter) {
+		fr.backend = backend
+	}
+}
+
+// WithResyncDebounce returns a FileReporterOption which overrides how long
+// the out-of-band change watcher waits after the last notification before
+// triggering a full resync. Defaults to 100ms.
+func WithResyncDebounce(d time.Duration) FileReporterOption {
+	return func(fr *EndpointStatusFileReporter) {
+		fr.resyncDebounce = d
+	}
+}
+
+// WithResyncPollInterval returns a FileReporterOption which overrides how
+// often the out-of-band change watcher polls each subsystem's status dir as
+// a fallback to inotify. A value <= 0 disables polling. Defaults to 30s.
+func WithResyncPollInterval(d time.Duration) FileReporterOption {
+	return func(fr *EndpointStatusFileReporter) {
+		fr.resyncPollInterval = d
+	}
+}
+
+// WithPayloadFormat returns a FileReporterOption which selects what gets
+// written as the body of a policy-status file. Defaults to FormatEmpty, so
+// existing consumers relying on empty files aren't broken.
+func WithPayloadFormat(format PayloadFormat) FileReporterOption {
+	return func(fr *EndpointStatusFileReporter) {
+		fr.payloadFormat = format
+	}
+}
+
 // SyncForever blocks until ctx is cancelled.
 // Continuously pulls status-updates from updates C,
 // and reconciles the filesystem with internal state.
 func (fr *EndpointStatusFileReporter) SyncForever(ctx context.Context) {
+	defer func() {
+		if err := fr.backend.Close(); err != nil {
+			logrus.WithError(err).Warn("Failed to close status backend")
+		}
+	}()
+
 	inSyncWithUpstream := false
 	var retryC <-chan time.Time // Starts out as nil, ignored by selects.
+
+	// Out-of-band changes (e.g. an errant cleanup script removing status
+	// files) only matter for the on-disk backend -- other backends either
+	// can't be watched this way or manage their own freshness. One watcher
+	// runs per registered subsystem, fanned into a single resyncC tagged
+	// with the subsystem name, so a change under one subsystem's directory
+	// only triggers a resync of that subsystem -- not every registered
+	// subsystem, which at cluster scale would turn one subsystem's churn
+	// into an O(total entries across all subsystems) disk-read storm on
+	// every debounce window. Primary detection is inotify via fsnotify,
+	// with a periodic poll alongside it as a fallback for filesystems
+	// where inotify is unreliable (NFS, some overlayfs setups); see
+	// status_watcher.go for the watcher implementation itself.
+	var resyncC <-chan resyncNotification
+	if lb, ok := fr.backend.(*localFSBackend); ok {
+		merged := make(chan resyncNotification, len(fr.subsystems))
+		for _, ss := range fr.subsystems {
+			// The subsystem's dir is otherwise only created lazily, by
+			// the first reconcileAll (via List). That runs after this
+			// watcher starts, so on a fresh boot fsw.Add below would
+			// fail against a directory that doesn't exist yet and the
+			// reporter would be stuck poll-only for the rest of the
+			// process. Create it eagerly here instead.
+			if err := lb.ensureKindDir(ss.name); err != nil {
+				logrus.WithError(err).WithField("subsystem", ss.name).
+					Warn("Failed to create status dir ahead of watching it; falling back to polling")
+			}
+
+			watcher := startPolicyDirWatcher(
+				ctx,
+				filepath.Join(lb.rootDir, ss.name),
+				fr.resyncDebounce,
+				fr.resyncPollInterval,
+			)
+			defer watcher.Stop()
+			go forwardNudges(ctx, watcher.resyncC, merged, ss.name)
+		}
+		resyncC = merged
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			logrus.Debug("Context cancelled, stopping...")
 			return
+		case notif, ok := <-resyncC:
+			if !ok {
+				resyncC = nil
+				continue
+			}
+			ss, ok := fr.subsystemsByName[notif.subsystem]
+			if !ok {
+				// Can't happen: forwardNudges is only ever started against
+				// a subsystem that's already registered.
+				continue
+			}
+			logrus.WithField("subsystem", notif.subsystem).
+				Debug("Detected out-of-band change to subsystem status dir, triggering resync...")
+			err := fr.reconcileSubsystem(ctx, ss, true)
+			if err != nil {
+				retryC = time.After(fr.bom.Step())
+			} else {
+				fr.bom.reset()
+				retryC = nil
+			}
 		case b, ok := <-fr.inSyncC:
 			if !ok {
 				logrus.Panic("InSync channel closed unexpectedly.")
@@ -136,7 +273,7 @@ func (fr *EndpointStatusFileReporter) SyncForever(ctx context.Context) {
 
 			if b == true {
 				inSyncWithUpstream = true
-				err := fr.reconcilePolicyFiles(true)
+				err := fr.reconcileAll(ctx, true)
 				if err != nil {
 					retryC = time.After(fr.bom.Step())
 				} else {
@@ -151,7 +288,7 @@ func (fr *EndpointStatusFileReporter) SyncForever(ctx context.Context) {
 			}
 			logrus.WithField("endpoint", e).Debug("Handling endpoint update")
 
-			err := fr.syncForeverHandleEndpointUpdate(e, inSyncWithUpstream)
+			err := fr.handleUpdate(ctx, e, inSyncWithUpstream)
 			if err != nil {
 				logrus.WithError(err).Warn("Encountered an error while handling an endpoint update. Queueing retry...")
 				retryC = time.After(fr.bom.Step())
@@ -164,7 +301,7 @@ func (fr *EndpointStatusFileReporter) SyncForever(ctx context.Context) {
 				logrus.Panic("Retry channel closed unexpectedly")
 			}
 
-			err := fr.reconcilePolicyFiles(true)
+			err := fr.reconcileAll(ctx, true)
 			if err != nil {
 				backoffDuration := fr.bom.Step()
 				logrus.WithError(err).WithField("backoff", backoffDuration.String()).
@@ -179,21 +316,28 @@ func (fr *EndpointStatusFileReporter) SyncForever(ctx context.Context) {
 	}
 }
 
-func (fr *EndpointStatusFileReporter) syncForeverHandleEndpointUpdate(e interface{}, commitToKernel bool) error {
-	switch m := e.(type) {
-	case *proto.WorkloadEndpointStatusUpdate:
-		fr.policyDirDeltaTracker.Desired().Add(m.Id)
-	case *proto.WorkloadEndpointStatusRemove:
-		fr.policyDirDeltaTracker.Desired().Delete(m.Id)
-	default:
+// handleUpdate fans e out to every registered subsystem whose matcher
+// accepts it, then (if commitToKernel) reconciles every subsystem.
+func (fr *EndpointStatusFileReporter) handleUpdate(ctx context.Context, e interface{}, commitToKernel bool) error {
+	matched := false
+	for _, ss := range fr.subsystems {
+		key, op := ss.matcher(e)
+		if op == OpIgnore {
+			continue
+		}
+		matched = true
+		ss.applyUpdate(ctx, e, key, op)
+	}
+
+	if !matched {
 		logrus.WithField("update", e).Warn("Skipping unrecognized endpoint update")
 		return nil
 	}
 
 	if commitToKernel {
-		err := fr.reconcilePolicyFiles(false)
+		err := fr.reconcileAll(ctx, false)
 		if err != nil {
-			return fmt.Errorf("Couldn't reconcile policy-status: %w", err)
+			return fmt.Errorf("Couldn't reconcile status dirs: %w", err)
 		}
 	}
 
@@ -201,44 +345,145 @@ func (fr *EndpointStatusFileReporter) syncForeverHandleEndpointUpdate(e interfac
 	return nil
 }
 
-func (fr *EndpointStatusFileReporter) writePolicyFile(wl *proto.WorkloadEndpointID) error {
-	// Write file to dir.
-	filename := filepath.Join(fr.endpointStatusDirPrefix, dirPolicyStatus, names.WorkloadEndpointIDToStatusFilename(wl))
-	f, err := os.Create(filename)
+// matchWorkloadEndpointStatus is the SubsystemMatcher for the built-in
+// "policy" subsystem.
+func matchWorkloadEndpointStatus(update interface{}) (string, SubsystemOp) {
+	switch m := update.(type) {
+	case *proto.WorkloadEndpointStatusUpdate:
+		return names.WorkloadEndpointIDToStatusFilename(m.Id), OpUpsert
+	case *proto.WorkloadEndpointStatusRemove:
+		return names.WorkloadEndpointIDToStatusFilename(m.Id), OpRemove
+	default:
+		return "", OpIgnore
+	}
+}
+
+// policyPayloadFunc is the "policy" subsystem's payloadFunc: it folds the
+// update into the stored PolicyStatus for its endpoint and renders it per
+// fr.payloadFormat.
+func (fr *EndpointStatusFileReporter) policyPayloadFunc(ctx context.Context, update interface{}, key string) []byte {
+	m, ok := update.(*proto.WorkloadEndpointStatusUpdate)
+	if !ok {
+		return nil
+	}
+
+	fr.recordPolicyStatus(ctx, key, m)
+	payload, err := fr.policyPayloads[key].marshal(fr.payloadFormat)
 	if err != nil {
-		return err
+		logrus.WithError(err).Warn("Failed to marshal policy status payload")
+		return nil
 	}
-	return f.Close()
+	return payload
 }
 
-func (fr *EndpointStatusFileReporter) deletePolicyFile(wl *proto.WorkloadEndpointID) error {
-	filename := filepath.Join(fr.endpointStatusDirPrefix, dirPolicyStatus, names.WorkloadEndpointIDToStatusFilename(wl))
-	return os.Remove(filename)
+// policyRemoveFunc is the "policy" subsystem's removeFunc: it drops the
+// PolicyStatus bookkeeping for key, so a later re-add starts fresh.
+func (fr *EndpointStatusFileReporter) policyRemoveFunc(key string) {
+	delete(fr.policyPayloads, key)
 }
 
-func (fr *EndpointStatusFileReporter) reconcilePolicyFiles(fullResync bool) error {
+// recordPolicyStatus folds m into the stored PolicyStatus for key, bumping
+// the generation and refreshing LastUpdated only when the reported status
+// has actually changed -- a duplicate update for an unchanged status is
+// idempotent, which is what lets reconcileSubsystem skip rewriting files
+// whose content hasn't moved.
+//
+// On a process restart, policyPayloads starts out empty even though the
+// endpoint may already have a status file from before the restart: the
+// first touch of key rehydrates Generation and FirstProgrammed from
+// whatever's already persisted, so a replayed update from upstream doesn't
+// reset them and make Generation look like it went backwards to a
+// consumer that's watching it.
+func (fr *EndpointStatusFileReporter) recordPolicyStatus(ctx context.Context, key string, m *proto.WorkloadEndpointStatusUpdate) {
+	status := m.Status.GetStatus()
+
+	ps, ok := fr.policyPayloads[key]
+	if !ok {
+		ps = fr.loadPersistedPolicyStatus(ctx, key)
+		if ps == nil {
+			now := time.Now()
+			ps = &PolicyStatus{
+				ID:              m.Id,
+				FirstProgrammed: now,
+				LastUpdated:     now,
+			}
+		}
+		fr.policyPayloads[key] = ps
+	}
+
+	if ps.Generation > 0 && ps.Status == status {
+		return
+	}
+	ps.Generation++
+	ps.LastUpdated = time.Now()
+	ps.Status = status
+}
+
+// loadPersistedPolicyStatus rehydrates the PolicyStatus previously written
+// for key, if any, so recordPolicyStatus can continue its Generation count
+// and keep its original FirstProgrammed across a process restart. Returns
+// nil if nothing's persisted yet, or the backend doesn't have it parseable
+// as a PolicyStatus (e.g. the reporter was previously run with
+// FormatEmpty).
+func (fr *EndpointStatusFileReporter) loadPersistedPolicyStatus(ctx context.Context, key string) *PolicyStatus {
+	payload, err := fr.backend.Load(ctx, dirPolicyStatus, key)
+	if err != nil {
+		return nil
+	}
+	var ps PolicyStatus
+	if err := json.Unmarshal(payload, &ps); err != nil {
+		return nil
+	}
+	return &ps
+}
+
+// reconcileAll reconciles every registered subsystem against the backend,
+// continuing past a subsystem's failure so one broken subsystem doesn't
+// block the others. The last error seen (if any) is returned so callers
+// can drive the usual backoff/retry behavior.
+func (fr *EndpointStatusFileReporter) reconcileAll(ctx context.Context, fullResync bool) error {
+	var lastError error
+	for _, ss := range fr.subsystems {
+		if err := fr.reconcileSubsystem(ctx, ss, fullResync); err != nil {
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+func (fr *EndpointStatusFileReporter) reconcileSubsystem(ctx context.Context, ss *Subsystem, fullResync bool) error {
 	if fullResync {
 		// If calling this due to the first in-sync msg from upstream,
 		// this will be a no-op.
-		fr.policyDirDeltaTracker.Dataplane().DeleteAll()
-
-		// Load any existing committed dataplane entries.
-		entries, err := ensurePolicyStatusDir(fr.endpointStatusDirPrefix)
+		ss.tracker.Dataplane().DeleteAll()
+
+		// Load any existing committed dataplane entries, along with their
+		// actual on-disk content hash -- List only tells us a key is
+		// present, which isn't enough to tell a key that's genuinely
+		// up to date from one whose last write never made it to the
+		// backend (e.g. a Save that failed partway through a prior
+		// reconcile). Reading the content back and hashing it is what
+		// lets this resync still notice that drift.
+		keys, err := fr.backend.List(ctx, ss.name)
 		if err != nil {
 			return err
 		}
-		for _, entry := range entries {
-			id := names.StatusFilenameToWorkloadEndpointID(entry.Name())
-			// TODO should this be a ReplaceAllIter?
-			fr.policyDirDeltaTracker.Dataplane().Add(id)
+		for _, key := range keys {
+			content, err := fr.backend.Load(ctx, ss.name, key)
+			if err != nil {
+				logrus.WithError(err).WithField("subsystem", ss.name).
+					Warn("Failed to read existing status entry during resync; will rewrite it if it's still desired")
+				continue
+			}
+			ss.tracker.Dataplane().Set(key, payloadHash(content))
 		}
 	}
 
 	var lastError error
-	fr.policyDirDeltaTracker.PendingUpdates().Iter(func(k *proto.WorkloadEndpointID) deltatracker.IterAction {
-		err := fr.writePolicyFile(k)
+	ss.tracker.PendingUpdates().Iter(func(key string, _ uint64) deltatracker.IterAction {
+		err := fr.backend.Save(ctx, ss.name, key, ss.payloads[key])
 		if err != nil {
-			logrus.WithError(err).Warn("Failed to write file to policy-status dir")
+			logrus.WithError(err).WithField("subsystem", ss.name).Warn("Failed to write status file")
 			lastError = err
 			return deltatracker.IterActionNoOp
 		}
@@ -246,10 +491,10 @@ func (fr *EndpointStatusFileReporter) reconcilePolicyFiles(fullResync bool) erro
 		return deltatracker.IterActionUpdateDataplane
 	})
 
-	fr.policyDirDeltaTracker.PendingDeletions().Iter(func(k *proto.WorkloadEndpointID) deltatracker.IterAction {
-		err := fr.deletePolicyFile(k)
+	ss.tracker.PendingDeletions().Iter(func(key string) deltatracker.IterAction {
+		err := fr.backend.Remove(ctx, ss.name, key)
 		if err != nil {
-			logrus.WithError(err).Warn("Failed to delete file in policy-status-dir")
+			logrus.WithError(err).WithField("subsystem", ss.name).Warn("Failed to delete status file")
 			// Carry on as normal (with a warning) if the file is somehow already deleted.
 			if !errors.Is(err, fs.ErrNotExist) {
 				lastError = err
@@ -263,20 +508,6 @@ func (fr *EndpointStatusFileReporter) reconcilePolicyFiles(fullResync bool) erro
 	return lastError
 }
 
-// ensurePolicyStatusDir ensures there is a directory named "policy", within
-// the parent dir specified by prefix. Attempts to create the dir if it doesn't exist.
-// Returns all entries within the dir if any exist.
-func ensurePolicyStatusDir(prefix string) (entries []fs.DirEntry, err error) {
-	filename := filepath.Join(prefix, dirPolicyStatus)
-
-	entries, err = os.ReadDir(filename)
-	if err != nil && errors.Is(err, fs.ErrNotExist) {
-		return entries, os.Mkdir(filename, 0644)
-	}
-
-	return entries, err
-}
-
 func newDefaultBackoff() Backoff {
 	return &wait.Backoff{
 		Duration: 50 * time.Millisecond,
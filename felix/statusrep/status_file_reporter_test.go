@@ -0,0 +1,375 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/projectcalico/calico/felix/proto"
+	"github.com/projectcalico/calico/libcalico-go/lib/names"
+)
+
+// countingBackend wraps a memoryBackend and counts Save calls, so tests can
+// assert that a reconcile didn't rewrite a file whose content hasn't
+// changed.
+type countingBackend struct {
+	*memoryBackend
+	saves int
+}
+
+func newCountingBackend() *countingBackend {
+	return &countingBackend{memoryBackend: newMemoryBackend()}
+}
+
+func (b *countingBackend) Save(ctx context.Context, kind, key string, payload []byte) error {
+	b.saves++
+	return b.memoryBackend.Save(ctx, kind, key, payload)
+}
+
+func newTestReporter(backend StatusBackend) *EndpointStatusFileReporter {
+	return NewEndpointStatusFileReporter(
+		make(chan interface{}),
+		make(chan bool),
+		"unused-because-backend-is-overridden",
+		WithStatusBackend(backend),
+		WithPayloadFormat(FormatJSON),
+	)
+}
+
+func testEndpointID() *proto.WorkloadEndpointID {
+	return &proto.WorkloadEndpointID{
+		OrchestratorId: "k8s",
+		WorkloadId:     "default/pod-1",
+		EndpointId:     "eth0",
+	}
+}
+
+func decodePolicyStatus(t *testing.T, payload []byte) *PolicyStatus {
+	t.Helper()
+	var ps PolicyStatus
+	if err := json.Unmarshal(payload, &ps); err != nil {
+		t.Fatalf("unmarshalling policy status: %v", err)
+	}
+	return &ps
+}
+
+func TestReconcilePolicyStatusFirstProgram(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryBackend()
+	fr := newTestReporter(backend)
+
+	id := testEndpointID()
+	key := names.WorkloadEndpointIDToStatusFilename(id)
+	update := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "up"}}
+
+	if err := fr.handleUpdate(ctx, update, true); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+
+	payload, err := backend.Load(ctx, dirPolicyStatus, key)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ps := decodePolicyStatus(t, payload)
+	if ps.Generation != 1 || ps.Status != "up" {
+		t.Fatalf("unexpected first-program payload: %+v", ps)
+	}
+}
+
+func TestReconcilePolicyStatusChangeRewritesFile(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingBackend()
+	fr := newTestReporter(backend)
+
+	id := testEndpointID()
+	key := names.WorkloadEndpointIDToStatusFilename(id)
+
+	up := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "up"}}
+	if err := fr.handleUpdate(ctx, up, true); err != nil {
+		t.Fatalf("handleUpdate(up): %v", err)
+	}
+	if backend.saves != 1 {
+		t.Fatalf("expected 1 save after first program, got %d", backend.saves)
+	}
+
+	// A duplicate update reporting the same status shouldn't cause a
+	// rewrite: recordPolicyStatus is idempotent for an unchanged status.
+	if err := fr.handleUpdate(ctx, up, true); err != nil {
+		t.Fatalf("handleUpdate(up again): %v", err)
+	}
+	if backend.saves != 1 {
+		t.Fatalf("expected duplicate status update not to trigger a rewrite, saves=%d", backend.saves)
+	}
+
+	// A status change must be written immediately...
+	errored := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "error"}}
+	if err := fr.handleUpdate(ctx, errored, true); err != nil {
+		t.Fatalf("handleUpdate(error): %v", err)
+	}
+	if backend.saves != 2 {
+		t.Fatalf("expected status change to trigger a rewrite, saves=%d", backend.saves)
+	}
+
+	payload, err := backend.Load(ctx, dirPolicyStatus, key)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ps := decodePolicyStatus(t, payload)
+	if ps.Generation != 2 || ps.Status != "error" {
+		t.Fatalf("unexpected post-change payload: %+v", ps)
+	}
+}
+
+// TestReconcilePolicyStatusChangeSurvivesFullResync is a regression test for
+// a bug where a changed payload that hadn't yet made it to the backend (e.g.
+// because the update arrived with commitToKernel=false, or a prior Save
+// failed) would be silently dropped by the next full resync: reconcileAll
+// rebuilt the dataplane side of the delta tracker purely from backend.List,
+// which only reports key presence, so a key already present locally looked
+// fully reconciled even though its desired content had moved on. Keying the
+// tracker on a content hash (and reading real content back via Load on
+// resync) is what makes the drift visible again.
+func TestReconcilePolicyStatusChangeSurvivesFullResync(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingBackend()
+	fr := newTestReporter(backend)
+
+	id := testEndpointID()
+	key := names.WorkloadEndpointIDToStatusFilename(id)
+
+	up := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "up"}}
+	if err := fr.handleUpdate(ctx, up, true); err != nil {
+		t.Fatalf("handleUpdate(up): %v", err)
+	}
+	if backend.saves != 1 {
+		t.Fatalf("expected 1 save after first program, got %d", backend.saves)
+	}
+
+	// Fold a status change into the in-memory desired state without
+	// reconciling, simulating an update that arrives before upstream is
+	// back in sync, or a reconcile that failed partway through.
+	errored := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "error"}}
+	if err := fr.handleUpdate(ctx, errored, false); err != nil {
+		t.Fatalf("handleUpdate(error, uncommitted): %v", err)
+	}
+	if backend.saves != 1 {
+		t.Fatalf("expected no save yet, saves=%d", backend.saves)
+	}
+
+	// A full resync (e.g. the first in-sync signal, or a retry after a
+	// failure) must still pick up the pending content change.
+	if err := fr.reconcileAll(ctx, true); err != nil {
+		t.Fatalf("reconcileAll: %v", err)
+	}
+	if backend.saves != 2 {
+		t.Fatalf("expected the full resync to rewrite the drifted file, saves=%d", backend.saves)
+	}
+
+	payload, err := backend.Load(ctx, dirPolicyStatus, key)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ps := decodePolicyStatus(t, payload)
+	if ps.Status != "error" {
+		t.Fatalf("expected resync to have written the latest status, got %+v", ps)
+	}
+
+	// A second full resync with nothing new to say should be a no-op.
+	if err := fr.reconcileAll(ctx, true); err != nil {
+		t.Fatalf("reconcileAll (second): %v", err)
+	}
+	if backend.saves != 2 {
+		t.Fatalf("expected a no-op resync not to rewrite an unchanged file, saves=%d", backend.saves)
+	}
+}
+
+func TestReconcilePolicyStatusRemove(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryBackend()
+	fr := newTestReporter(backend)
+
+	id := testEndpointID()
+	key := names.WorkloadEndpointIDToStatusFilename(id)
+
+	up := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "up"}}
+	if err := fr.handleUpdate(ctx, up, true); err != nil {
+		t.Fatalf("handleUpdate(up): %v", err)
+	}
+	if _, err := backend.Load(ctx, dirPolicyStatus, key); err != nil {
+		t.Fatalf("expected entry to exist before remove: %v", err)
+	}
+
+	remove := &proto.WorkloadEndpointStatusRemove{Id: id}
+	if err := fr.handleUpdate(ctx, remove, true); err != nil {
+		t.Fatalf("handleUpdate(remove): %v", err)
+	}
+
+	if _, err := backend.Load(ctx, dirPolicyStatus, key); err == nil {
+		t.Fatalf("expected entry to be gone after remove")
+	}
+	if _, ok := fr.policyPayloads[key]; ok {
+		t.Fatalf("expected policyPayloads bookkeeping to be cleared after remove")
+	}
+}
+
+func TestReconcileAllRebuildsDataplaneFromBackendOnFullResync(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingBackend()
+	fr := newTestReporter(backend)
+
+	id := testEndpointID()
+	key := names.WorkloadEndpointIDToStatusFilename(id)
+
+	// Seed the backend directly, as if another process (or a prior run)
+	// had already written this entry, without going through handleUpdate.
+	up := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "up"}}
+	fr.recordPolicyStatus(ctx, key, up)
+	payload, err := fr.policyPayloads[key].marshal(fr.payloadFormat)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := backend.Save(ctx, dirPolicyStatus, key, payload); err != nil {
+		t.Fatalf("seeding backend: %v", err)
+	}
+
+	// Folding the identical update into the desired set and doing a full
+	// resync should find nothing to do: the hash of the desired payload
+	// matches what's already on disk.
+	ss := fr.subsystemsByName[dirPolicyStatus]
+	ss.applyUpdate(ctx, up, key, OpUpsert)
+
+	if err := fr.reconcileAll(ctx, true); err != nil {
+		t.Fatalf("reconcileAll: %v", err)
+	}
+	if backend.saves != 1 {
+		t.Fatalf("expected the full resync not to rewrite the seeded entry, saves=%d", backend.saves)
+	}
+
+	got, err := backend.Load(ctx, dirPolicyStatus, key)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if string(got) != string(payload) {
+		t.Fatalf("expected resync to leave matching content untouched, got %q want %q", got, payload)
+	}
+}
+
+// matchRouteUpdate is a SubsystemMatcher for a second, non-built-in
+// subsystem used by the tests below: it accepts a bare string (a CIDR) and
+// ignores anything else, so it never matches the proto updates the "policy"
+// subsystem cares about, and vice versa.
+func matchRouteUpdate(update interface{}) (string, SubsystemOp) {
+	cidr, ok := update.(string)
+	if !ok {
+		return "", OpIgnore
+	}
+	return cidr, OpUpsert
+}
+
+func TestHandleUpdateFansOutOnlyToMatchingSubsystems(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryBackend()
+	fr := newTestReporter(backend)
+
+	if err := fr.RegisterSubsystem("routes", matchRouteUpdate); err != nil {
+		t.Fatalf("RegisterSubsystem: %v", err)
+	}
+
+	id := testEndpointID()
+	policyKey := names.WorkloadEndpointIDToStatusFilename(id)
+	policyUpdate := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "up"}}
+	routeKey := "10.0.0.1/32"
+
+	if err := fr.handleUpdate(ctx, policyUpdate, true); err != nil {
+		t.Fatalf("handleUpdate(policy): %v", err)
+	}
+	if err := fr.handleUpdate(ctx, routeKey, true); err != nil {
+		t.Fatalf("handleUpdate(route): %v", err)
+	}
+
+	if _, err := backend.Load(ctx, dirPolicyStatus, policyKey); err != nil {
+		t.Fatalf("expected policy update to land in the policy subsystem: %v", err)
+	}
+	if _, err := backend.Load(ctx, "routes", policyKey); err == nil {
+		t.Fatalf("expected policy update not to land in the routes subsystem")
+	}
+
+	if _, err := backend.Load(ctx, "routes", routeKey); err != nil {
+		t.Fatalf("expected route update to land in the routes subsystem: %v", err)
+	}
+	if _, err := backend.Load(ctx, dirPolicyStatus, routeKey); err == nil {
+		t.Fatalf("expected route update not to land in the policy subsystem")
+	}
+}
+
+// TestReconcileSubsystemOnlyReconcilesThatSubsystem is a regression test for
+// the per-subsystem resync path added to SyncForever: when only one
+// subsystem's watcher fires, it must resync that subsystem alone rather
+// than falling back to reconcileAll's every-subsystem sweep.
+func TestReconcileSubsystemOnlyReconcilesThatSubsystem(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingBackend()
+	fr := newTestReporter(backend)
+
+	if err := fr.RegisterSubsystem("routes", matchRouteUpdate); err != nil {
+		t.Fatalf("RegisterSubsystem: %v", err)
+	}
+
+	id := testEndpointID()
+	policyKey := names.WorkloadEndpointIDToStatusFilename(id)
+	policyUpdate := &proto.WorkloadEndpointStatusUpdate{Id: id, Status: &proto.EndpointStatus{Status: "up"}}
+	routeKey := "10.0.0.1/32"
+
+	// Fold both updates into their subsystems' desired state without
+	// reconciling, so both start out with a pending update.
+	if err := fr.handleUpdate(ctx, policyUpdate, false); err != nil {
+		t.Fatalf("handleUpdate(policy): %v", err)
+	}
+	if err := fr.handleUpdate(ctx, routeKey, false); err != nil {
+		t.Fatalf("handleUpdate(route): %v", err)
+	}
+	if backend.saves != 0 {
+		t.Fatalf("expected no saves before reconciling, got %d", backend.saves)
+	}
+
+	// Reconciling just "routes" -- as SyncForever does when only its watcher
+	// fires -- must write routes' pending update and leave policy's alone.
+	routesSS := fr.subsystemsByName["routes"]
+	if err := fr.reconcileSubsystem(ctx, routesSS, true); err != nil {
+		t.Fatalf("reconcileSubsystem(routes): %v", err)
+	}
+	if backend.saves != 1 {
+		t.Fatalf("expected exactly one save from reconciling routes alone, got %d", backend.saves)
+	}
+	if _, err := backend.Load(ctx, "routes", routeKey); err != nil {
+		t.Fatalf("expected routes entry to be written: %v", err)
+	}
+	if _, err := backend.Load(ctx, dirPolicyStatus, policyKey); err == nil {
+		t.Fatalf("expected policy's pending update to be untouched by the routes-only reconcile")
+	}
+
+	// reconcileAll still picks up the remaining policy update.
+	if err := fr.reconcileAll(ctx, true); err != nil {
+		t.Fatalf("reconcileAll: %v", err)
+	}
+	if backend.saves != 2 {
+		t.Fatalf("expected reconcileAll to pick up the remaining policy update, got %d", backend.saves)
+	}
+	if _, err := backend.Load(ctx, dirPolicyStatus, policyKey); err != nil {
+		t.Fatalf("expected policy entry to be written after reconcileAll: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"time"
+
+	"github.com/projectcalico/calico/felix/proto"
+)
+
+// PayloadFormat selects what gets written as the body of a policy-status
+// file.
+type PayloadFormat int
+
+const (
+	// FormatEmpty writes a zero-length file, same as this package has
+	// always done: consumers can only tell "programmed at some point"
+	// from the file's existence.
+	FormatEmpty PayloadFormat = iota
+
+	// FormatJSON writes a PolicyStatus document per endpoint, letting
+	// consumers distinguish first-programmed from last-updated, see
+	// generation counts, and read the last reported status/error.
+	FormatJSON
+)
+
+// PolicyStatus is the structured payload written per-endpoint into the
+// "policy" status directory when the reporter is configured with
+// WithPayloadFormat(FormatJSON).
+//
+// There's deliberately no separate error/reason field here: proto.EndpointStatus
+// only ever reports a Status string (e.g. "up"/"error"), with no accompanying
+// diagnostic message, so there's nothing beyond Status to surface.
+type PolicyStatus struct {
+	ID              *proto.WorkloadEndpointID `json:"id"`
+	Generation      uint64                    `json:"generation"`
+	FirstProgrammed time.Time                 `json:"firstProgrammed"`
+	LastUpdated     time.Time                 `json:"lastUpdated"`
+	Status          string                    `json:"status"`
+}
+
+// marshal renders ps per the given format. FormatEmpty always yields nil,
+// matching the historical zero-length file.
+func (ps *PolicyStatus) marshal(format PayloadFormat) ([]byte, error) {
+	if format == FormatEmpty || ps == nil {
+		return nil, nil
+	}
+	return json.Marshal(ps)
+}
+
+// payloadHash summarises payload's content as a single value suitable for
+// use as a MapDeltaTracker value, so reconcileSubsystem can tell an
+// unchanged payload from a changed one without comparing bytes directly.
+func payloadHash(payload []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(payload) //nolint:errcheck // hash.Hash.Write never returns an error.
+	return h.Sum64()
+}
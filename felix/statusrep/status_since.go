@@ -0,0 +1,67 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/projectcalico/calico/felix/proto"
+	"github.com/projectcalico/calico/libcalico-go/lib/names"
+)
+
+// ListChangedSince scans the on-disk policy-status dir and returns the IDs
+// of endpoints whose status file has an mtime at or after since. This
+// mirrors the motivation behind `--since` on container log tooling:
+// operators want to ask "what programming events happened in the last N
+// seconds" without standing up an external state store.
+//
+// Only supported when the reporter is using the default local-filesystem
+// backend; other backends don't expose mtimes in a comparable way.
+//
+// Deliberately scoped to the built-in "policy" subsystem only: its return
+// type is a WorkloadEndpointID, which is specific to policy's keying
+// scheme, whereas other subsystems registered via RegisterSubsystem (e.g.
+// "routes", "ipsets") key on whatever's natural for them (a CIDR, an
+// ipset name, ...) and have no such type to return. The out-of-band
+// change watcher (see status_watcher.go) isn't under this limitation and
+// does cover every registered subsystem.
+func (fr *EndpointStatusFileReporter) ListChangedSince(since time.Time) ([]*proto.WorkloadEndpointID, error) {
+	lb, ok := fr.backend.(*localFSBackend)
+	if !ok {
+		return nil, fmt.Errorf("ListChangedSince is only supported with the local filesystem backend")
+	}
+
+	dir := filepath.Join(lb.rootDir, dirPolicyStatus)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*proto.WorkloadEndpointID
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().Before(since) {
+			continue
+		}
+		changed = append(changed, names.StatusFilenameToWorkloadEndpointID(entry.Name()))
+	}
+	return changed, nil
+}
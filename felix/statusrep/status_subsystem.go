@@ -0,0 +1,137 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/projectcalico/calico/felix/deltatracker"
+)
+
+// SubsystemOp describes what an update matched by a SubsystemMatcher
+// implies for that subsystem's desired set.
+type SubsystemOp int
+
+const (
+	// OpIgnore means the update isn't relevant to this subsystem.
+	OpIgnore SubsystemOp = iota
+	// OpUpsert means key should be present, programmed from update.
+	OpUpsert
+	// OpRemove means key should no longer be present.
+	OpRemove
+)
+
+// SubsystemMatcher inspects an incoming update (whatever felix sent down
+// EndpointStatusFileReporter's endpointUpdatesC) and reports whether -- and
+// how -- it affects one subsystem's desired set. key is only meaningful
+// when op isn't OpIgnore.
+type SubsystemMatcher func(update interface{}) (key string, op SubsystemOp)
+
+// Subsystem is one named, independently-reconciled status directory (e.g.
+// "policy", "routes", "ipsets", "bpf"), each with its own desired/dataplane
+// delta tracker and its own directory under endpointStatusDirPrefix.
+type Subsystem struct {
+	name    string
+	matcher SubsystemMatcher
+
+	// payloadFunc builds the bytes to persist for an OpUpsert of update
+	// under key. nil means "write an empty marker file", preserving the
+	// original presence-only behavior. ctx is threaded through so a
+	// payloadFunc can consult the backend itself (e.g. "policy" rehydrates
+	// Generation/FirstProgrammed from whatever's already persisted, on the
+	// first touch of a key).
+	payloadFunc func(ctx context.Context, update interface{}, key string) []byte
+
+	// removeFunc, if set, is called when key is removed from the desired
+	// set, so a subsystem can drop any payload bookkeeping it keeps
+	// outside of Subsystem itself (e.g. "policy"'s PolicyStatus cache).
+	removeFunc func(key string)
+
+	// tracker is keyed by the same key as payloads, with the value being a
+	// hash of the payload's content (see payloadHash). Keying the delta
+	// tracker on content, not just presence, means a key that's already
+	// desired and already on disk is still flagged as a pending update when
+	// its payload changes underneath it -- including across a full resync,
+	// where List can only tell us a key is present, not what content it
+	// holds (see reconcileSubsystem).
+	tracker  *deltatracker.MapDeltaTracker[string, uint64]
+	payloads map[string][]byte
+}
+
+func newSubsystem(name string, matcher SubsystemMatcher, payloadFunc func(ctx context.Context, update interface{}, key string) []byte, removeFunc func(key string)) *Subsystem {
+	return &Subsystem{
+		name:        name,
+		matcher:     matcher,
+		payloadFunc: payloadFunc,
+		removeFunc:  removeFunc,
+		tracker:     deltatracker.NewMapDeltaTracker[string, uint64](),
+		payloads:    map[string][]byte{},
+	}
+}
+
+// applyUpdate folds an OpUpsert/OpRemove for key into the subsystem's
+// desired state. For OpUpsert with a payloadFunc, the computed payload's
+// hash becomes the desired value for key, so a later reconcileSubsystem
+// finds a pending update for any key whose content has moved since it was
+// last written -- regardless of whether key was already present before.
+func (ss *Subsystem) applyUpdate(ctx context.Context, update interface{}, key string, op SubsystemOp) {
+	switch op {
+	case OpUpsert:
+		var payload []byte
+		if ss.payloadFunc != nil {
+			payload = ss.payloadFunc(ctx, update, key)
+		}
+		ss.payloads[key] = payload
+		ss.tracker.Desired().Set(key, payloadHash(payload))
+	case OpRemove:
+		delete(ss.payloads, key)
+		if ss.removeFunc != nil {
+			ss.removeFunc(key)
+		}
+		ss.tracker.Desired().Delete(key)
+	}
+}
+
+// RegisterSubsystem adds a new named status subsystem with its own
+// directory under endpointStatusDirPrefix, reconciled with the same
+// full-resync/backoff semantics as the built-in "policy" subsystem.
+// matcher is consulted for every update SyncForever receives; an OpIgnore
+// result means the update isn't relevant to this subsystem. Subsystems
+// registered this way always use empty marker files -- structured payloads
+// (like "policy"'s PolicyStatus) are a detail specific to subsystems
+// defined within this package today.
+//
+// Must be called before SyncForever starts: subsystem registration isn't
+// synchronized with the sync loop.
+func (fr *EndpointStatusFileReporter) RegisterSubsystem(name string, matcher SubsystemMatcher) error {
+	return fr.registerSubsystem(name, matcher, nil, nil)
+}
+
+func (fr *EndpointStatusFileReporter) registerSubsystem(
+	name string,
+	matcher SubsystemMatcher,
+	payloadFunc func(ctx context.Context, update interface{}, key string) []byte,
+	removeFunc func(key string),
+) error {
+	if _, exists := fr.subsystemsByName[name]; exists {
+		return fmt.Errorf("subsystem %q is already registered", name)
+	}
+
+	ss := newSubsystem(name, matcher, payloadFunc, removeFunc)
+	fr.subsystemsByName[name] = ss
+	fr.subsystems = append(fr.subsystems, ss)
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2024 Tigera, Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statusrep
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultResyncDebounce     = 100 * time.Millisecond
+	defaultResyncPollInterval = 30 * time.Second
+)
+
+// policyDirWatcher notices when one subsystem's status directory has
+// changed out from under the reporter -- e.g. an operator or an errant
+// cleanup script removing files -- and nudges SyncForever into a full
+// resync. It owns no reconciliation logic of its own: a send on resyncC
+// makes SyncForever run a full resync of this watcher's subsystem only,
+// and the existing delta-tracker based full resync does the actual
+// diffing. SyncForever
+// runs one of these per registered subsystem, so out-of-band changes are
+// caught under every subsystem's directory, not just the built-in
+// "policy" one.
+//
+// Primary detection is inotify via fsnotify; a periodic poll runs
+// alongside it as a fallback for filesystems where inotify is unreliable
+// (NFS, some overlayfs setups). If inotify isn't available on this
+// platform, watcher creation degrades to poll-only rather than failing.
+type policyDirWatcher struct {
+	resyncC chan struct{}
+	cancel  context.CancelFunc
+}
+
+// startPolicyDirWatcher starts watching dir and returns immediately; the
+// returned watcher must be stopped with Stop once the caller is done with
+// it. pollInterval <= 0 disables the polling fallback.
+func startPolicyDirWatcher(ctx context.Context, dir string, debounce, pollInterval time.Duration) *policyDirWatcher {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &policyDirWatcher{
+		resyncC: make(chan struct{}, 1),
+		cancel:  cancel,
+	}
+
+	notifyC := make(chan struct{}, 1)
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.WithError(err).WithField("dir", dir).Warn("Failed to create inotify watcher for status dir; falling back to polling only.")
+		fsw = nil
+	} else if err := fsw.Add(dir); err != nil {
+		logrus.WithError(err).WithField("dir", dir).Warn("Failed to watch status dir with inotify; falling back to polling only.")
+		_ = fsw.Close()
+		fsw = nil
+	}
+
+	if fsw != nil {
+		go w.runFSNotifyLoop(ctx, fsw, notifyC)
+	}
+
+	go w.runPoller(ctx, dir, pollInterval, notifyC)
+	go w.runDebouncer(ctx, notifyC, debounce)
+
+	return w
+}
+
+// Stop releases the watcher's goroutines and any held OS resources.
+func (w *policyDirWatcher) Stop() {
+	w.cancel()
+}
+
+func (w *policyDirWatcher) runFSNotifyLoop(ctx context.Context, fsw *fsnotify.Watcher, notifyC chan<- struct{}) {
+	defer fsw.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			nudge(notifyC)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			logrus.WithError(err).Warn("Error from status dir inotify watcher")
+		}
+	}
+}
+
+// runPoller is the fallback for filesystems where inotify is unreliable: it
+// lists dir every interval and only nudges notifyC when that listing has
+// actually changed since the last poll, rather than unconditionally -- a
+// full resync re-reads and hashes every entry in dir (see
+// reconcileSubsystem), so nudging on a timer regardless of whether
+// anything changed would mean paying that cost at every poll even at
+// steady state.
+func (w *policyDirWatcher) runPoller(ctx context.Context, dir string, interval time.Duration, notifyC chan<- struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last, _ := readDirNames(dir)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			names, err := readDirNames(dir)
+			if err != nil {
+				logrus.WithError(err).WithField("dir", dir).Warn("Failed to poll status dir for out-of-band changes")
+				continue
+			}
+			if !namesEqual(last, names) {
+				last = names
+				nudge(notifyC)
+			}
+		}
+	}
+}
+
+// readDirNames returns the sorted names of dir's entries, for cheap
+// comparison between polls. os.ReadDir already returns entries sorted by
+// filename.
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, nil
+}
+
+func namesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// runDebouncer coalesces bursts of notifications (e.g. several inotify
+// events from one directory listing churn) into a single resync signal.
+func (w *policyDirWatcher) runDebouncer(ctx context.Context, notifyC <-chan struct{}, debounce time.Duration) {
+	var timerC <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-notifyC:
+			if !ok {
+				return
+			}
+			timerC = time.After(debounce)
+		case <-timerC:
+			timerC = nil
+			nudge(w.resyncC)
+		}
+	}
+}
+
+// nudge is a non-blocking send: if the channel already has a pending
+// notification queued, there's no need to queue another.
+func nudge(c chan<- struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// resyncNotification identifies which subsystem's directory a watcher saw
+// change out from under the reporter, so SyncForever can resync just that
+// subsystem instead of every registered one.
+type resyncNotification struct {
+	subsystem string
+}
+
+// forwardNudges relays every notification from in to out, tagged with
+// subsystem, until ctx is cancelled or in is closed. This is how several
+// per-subsystem watchers get fanned into the single resync channel
+// SyncForever selects on while keeping each notification attributable to
+// the subsystem it came from. Sends to out block rather than drop: in is
+// already debounced to at most one pending notification per subsystem, and
+// out is sized for one slot per registered subsystem, so this can't wedge
+// as long as SyncForever keeps draining it.
+func forwardNudges(ctx context.Context, in <-chan struct{}, out chan<- resyncNotification, subsystem string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-in:
+			if !ok {
+				return
+			}
+			select {
+			case out <- resyncNotification{subsystem: subsystem}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}